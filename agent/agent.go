@@ -0,0 +1,289 @@
+// Package agent implements a small long-running daemon that keeps a
+// decrypted OpenPGP keyring in memory behind a Unix domain socket, so
+// encrypt.PGP doesn't have to re-prompt for a passphrase on every
+// operation.
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const (
+	opDecrypt     byte = 'D'
+	opEncrypt     byte = 'E'
+	opSign        byte = 'G'
+	opIdentities  byte = 'I'
+	opFingerprint byte = 'F'
+	opStop        byte = 'S'
+
+	statusOK  byte = 0
+	statusErr byte = 1
+
+	// maxPayload caps a request body read from the socket before we
+	// allocate a buffer for it. Generously larger than any real secret or
+	// signing payload, it exists only to stop an unauthenticated local
+	// peer from OOMing the agent with a bogus length prefix.
+	maxPayload = 64 << 20
+)
+
+// SocketPath is the location of the agent's Unix socket: $XDG_RUNTIME_DIR
+// if set, otherwise a private per-uid directory under the system temp
+// dir, since a bare socket file sitting directly in a shared, world-
+// writable /tmp would let any other local user connect to it.
+func SocketPath() string {
+	return fmt.Sprintf("%s/gpass-agent.sock", socketDir())
+}
+
+func socketDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return fmt.Sprintf("%s/gpass-agent-%d", os.TempDir(), os.Getuid())
+}
+
+// Server keeps a decrypted keyring in memory and serves Decrypt/Encrypt/
+// Sign/Identities requests over a Unix socket until ttl elapses with no
+// activity.
+type Server struct {
+	mu       sync.Mutex
+	entities openpgp.EntityList
+	ttl      time.Duration
+	lastUsed time.Time
+	listener net.Listener
+}
+
+// NewServer returns a Server that keeps entities cached for ttl after
+// their last use.
+func NewServer(entities openpgp.EntityList, ttl time.Duration) *Server {
+	return &Server{entities: entities, ttl: ttl, lastUsed: time.Now()}
+}
+
+// Serve listens on SocketPath until Stop is called or ttl elapses with no
+// activity.
+func (s *Server) Serve() error {
+	if err := lockMemory(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to lock the decrypted keyring in memory: %s\n", err)
+	}
+
+	if os.Getenv("XDG_RUNTIME_DIR") == "" {
+		dir := socketDir()
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("XDG_RUNTIME_DIR is not set and gpass couldn't create a private fallback directory at %s: %s", dir, err)
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("Unable to secure %s: %s", dir, err)
+		}
+	}
+
+	if err := os.Remove(SocketPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to clear stale socket: %s", err)
+	}
+
+	l, err := net.Listen("unix", SocketPath())
+	if err != nil {
+		return fmt.Errorf("Unable to listen on %s: %s", SocketPath(), err)
+	}
+	if err := os.Chmod(SocketPath(), 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("Unable to secure the agent socket: %s", err)
+	}
+	s.listener = l
+	defer l.Close()
+
+	go s.reapLoop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil
+		}
+		go s.handle(conn)
+	}
+}
+
+// Stop closes the listening socket, ending Serve.
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Stop asks a running gpass agent to shut down.
+func Stop() error {
+	conn, err := net.Dial("unix", SocketPath())
+	if err != nil {
+		return fmt.Errorf("No gpass agent appears to be running: %s", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{opStop})
+	return err
+}
+
+func (s *Server) reapLoop() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for range t.C {
+		s.mu.Lock()
+		idle := time.Since(s.lastUsed)
+		s.mu.Unlock()
+
+		if idle > s.ttl {
+			s.Stop()
+			return
+		}
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	op := make([]byte, 1)
+	if _, err := io.ReadFull(conn, op); err != nil {
+		return
+	}
+
+	if op[0] == opStop {
+		s.Stop()
+		return
+	}
+
+	var length uint32
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return
+	}
+	if length > maxPayload {
+		return
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	entities := s.entities
+	s.mu.Unlock()
+
+	var result []byte
+	var err error
+
+	switch op[0] {
+	case opDecrypt:
+		result, err = decrypt(payload, entities)
+	case opEncrypt:
+		result, err = encrypt(payload, entities)
+	case opSign:
+		result, err = sign(payload, entities)
+	case opIdentities:
+		result, err = identities(entities), nil
+	case opFingerprint:
+		result, err = fingerprints(entities), nil
+	default:
+		err = fmt.Errorf("Unknown operation requested")
+	}
+
+	if err != nil {
+		conn.Write([]byte{statusErr})
+		binary.Write(conn, binary.BigEndian, uint32(len(err.Error())))
+		conn.Write([]byte(err.Error()))
+		return
+	}
+
+	conn.Write([]byte{statusOK})
+	binary.Write(conn, binary.BigEndian, uint32(len(result)))
+	conn.Write(result)
+}
+
+func decrypt(armored []byte, entities openpgp.EntityList) ([]byte, error) {
+	block, err := armor.Decode(bytes.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PGP message or not armor encoded: %s", err)
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, entities, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt the message: %s", err)
+	}
+
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
+
+func encrypt(message []byte, entities openpgp.EntityList) ([]byte, error) {
+	var w bytes.Buffer
+
+	b, err := armor.Encode(&w, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to armor encode")
+	}
+
+	e, err := openpgp.Encrypt(b, entities, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load keyring for encryption: %s", err)
+	}
+
+	if _, err := e.Write(message); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	if err := b.Close(); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(&w)
+}
+
+func sign(data []byte, entities openpgp.EntityList) ([]byte, error) {
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("No private key loaded")
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entities[0], bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("Unable to sign data: %s", err)
+	}
+
+	return sig.Bytes(), nil
+}
+
+func identities(entities openpgp.EntityList) []byte {
+	var ids []string
+
+	for _, e := range entities {
+		for _, ident := range e.Identities {
+			ids = append(ids, ident.Name)
+		}
+	}
+
+	return []byte(strings.Join(ids, "\n"))
+}
+
+// fingerprints returns the hex-encoded fingerprints of entities, so a
+// caller can confirm the agent actually has the identity it's about to
+// rely on cached, rather than just any identity.
+func fingerprints(entities openpgp.EntityList) []byte {
+	var fps []string
+
+	for _, e := range entities {
+		fps = append(fps, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint))
+	}
+
+	return []byte(strings.Join(fps, "\n"))
+}
@@ -0,0 +1,20 @@
+// +build linux
+
+package agent
+
+import "syscall"
+
+// lockMemory locks the process's currently resident pages (MCL_CURRENT,
+// not MCL_FUTURE) so the decrypted keyring this daemon holds for its
+// whole TTL-bounded lifetime isn't swapped to disk. An earlier version of
+// this locked only the raw armored private key buffer handed to
+// NewServer, but that buffer is still-encrypted ciphertext -- it's the
+// entities built from it, not it, that are actually sensitive and
+// resident for the long haul. Precisely mlock'ing the interior
+// allocations of an *openpgp.Entity isn't practical in stock Go, so we
+// lock everything currently mapped instead; MCL_FUTURE is deliberately
+// left off so this doesn't also pin every allocation the daemon makes
+// afterwards.
+func lockMemory() error {
+	return syscall.Mlockall(syscall.MCL_CURRENT)
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package agent
+
+import "fmt"
+
+// lockMemory locks nothing on platforms other than Linux and always
+// returns an error saying so.
+func lockMemory() error {
+	return fmt.Errorf("memory locking is not implemented on this platform")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eiso/gpass/agent"
+	"github.com/eiso/gpass/encrypt"
+	"github.com/eiso/gpass/utils"
+	"github.com/spf13/cobra"
+)
+
+type AgentCmd struct {
+	ttl time.Duration
+}
+
+func NewAgentCmd() *AgentCmd {
+	return &AgentCmd{}
+}
+
+func (c *AgentCmd) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Runs a background agent that caches your decrypted private key.",
+	}
+
+	start := &cobra.Command{
+		Use:   "start",
+		Short: "Starts the gpass agent in the foreground.",
+		Args:  cobra.NoArgs,
+		RunE:  c.start,
+	}
+	start.Flags().DurationVar(&c.ttl, "ttl", 10*time.Minute, "How long to keep the private key cached after its last use.")
+
+	stop := &cobra.Command{
+		Use:   "stop",
+		Short: "Stops a running gpass agent.",
+		Args:  cobra.NoArgs,
+		RunE:  c.stop,
+	}
+
+	cmd.AddCommand(start)
+	cmd.AddCommand(stop)
+
+	return cmd
+}
+
+func (c *AgentCmd) start(cmd *cobra.Command, args []string) error {
+	if Cfg.Backend == "gpg-agent" {
+		return fmt.Errorf("the gpg-agent backend already caches your passphrase via the system gpg-agent; gpass agent only applies to the native backend")
+	}
+
+	if Cfg.PrivateKey == "" {
+		return fmt.Errorf("No private key configured, run gpass init first")
+	}
+
+	f, err := utils.LoadFile(Cfg.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("Unable to load the private key: %s", err)
+	}
+
+	k := encrypt.NewPGP(f, nil, nil, true)
+	if err := k.Keyring(); err != nil {
+		return fmt.Errorf("Unable to build keyring: %s", err)
+	}
+
+	s := agent.NewServer(encrypt.Entities(), c.ttl)
+
+	fmt.Printf("gpass agent listening on %s, caching for %s\n", agent.SocketPath(), c.ttl)
+
+	return s.Serve()
+}
+
+func (c *AgentCmd) stop(cmd *cobra.Command, args []string) error {
+	return agent.Stop()
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 
 	"github.com/eiso/gpass/encrypt"
 	"github.com/eiso/gpass/git"
@@ -12,7 +14,11 @@ import (
 )
 
 type InitCmd struct {
-	key string
+	key      string
+	backend  string
+	identity string
+	generate bool
+	signKey  string
 }
 
 func NewInitCmd() *InitCmd {
@@ -28,7 +34,10 @@ func (c *InitCmd) Cmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&c.key, "key", "k", "", "Path to your local private key.")
-	cmd.MarkFlagRequired("key")
+	cmd.Flags().StringVar(&c.backend, "backend", "native", "Crypto backend to use: \"native\" or \"gpg-agent\".")
+	cmd.Flags().StringVar(&c.identity, "identity", "", "Key ID or email gpg should use (gpg-agent backend only).")
+	cmd.Flags().BoolVar(&c.generate, "generate", false, "Generate a new private key instead of pointing at an existing one.")
+	cmd.Flags().StringVar(&c.signKey, "sign-key", "", "Path to a private key to GPG-sign future commits with.")
 
 	return cmd
 }
@@ -48,21 +57,94 @@ func (c *InitCmd) Execute(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	f, err := utils.LoadFile(c.key)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	Cfg.User = u
+	Cfg.Repository = r
 
-	k := encrypt.NewPGP(f, nil, nil, true)
+	var k encrypt.Crypto
+	var pub []byte
+	var keyringReady bool
+
+	switch {
+	case c.generate:
+		if c.backend != "native" {
+			return fmt.Errorf("--generate only works with the native backend")
+		}
+
+		passphrase, err := encrypt.PromptNewPassphrase()
+		if err != nil {
+			return err
+		}
+
+		priv, p, fingerprint, err := encrypt.GenerateKey(u.Name, u.Email, passphrase)
+		if err != nil {
+			return err
+		}
+		pub = p
+
+		keysDir := path.Join(u.HomeFolder, ".config", "gpass", "keys")
+		if err := os.MkdirAll(keysDir, 0700); err != nil {
+			return fmt.Errorf("Unable to create %s: %s", keysDir, err)
+		}
+
+		c.key = path.Join(keysDir, fingerprint+".asc")
+		if err := ioutil.WriteFile(c.key, priv, 0600); err != nil {
+			return fmt.Errorf("Unable to write the private key: %s", err)
+		}
+		if err := ioutil.WriteFile(path.Join(keysDir, fingerprint+".pub.asc"), pub, 0644); err != nil {
+			return fmt.Errorf("Unable to write the public key: %s", err)
+		}
+
+		Cfg.Fingerprint = fingerprint
+		pgp := encrypt.NewPGP(priv, nil, nil, true)
+		if err := pgp.KeyringWithPassphrase(passphrase); err != nil {
+			return fmt.Errorf("Unable to build keyring: %s", err)
+		}
+		k = pgp
+		keyringReady = true
+	case c.backend == "gpg-agent":
+		if c.identity == "" {
+			return fmt.Errorf("--identity is required when using the gpg-agent backend")
+		}
+		k = encrypt.NewGPGAgent(c.identity)
+	case c.backend == "native":
+		if c.key == "" {
+			return fmt.Errorf("--key is required when using the native backend, or pass --generate to create one")
+		}
+
+		f, err := utils.LoadFile(c.key)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		k = encrypt.NewPGP(f, nil, nil, true)
+	default:
+		return fmt.Errorf("Unknown crypto backend: %s", c.backend)
+	}
 
-	if err := k.Keyring(); err != nil {
-		return fmt.Errorf("Unable to build keyring: %s", err)
+	if !keyringReady {
+		if err := k.Keyring(); err != nil {
+			return fmt.Errorf("Unable to build keyring: %s", err)
+		}
 	}
 
-	Cfg.User = u
-	Cfg.Repository = r
 	Cfg.PrivateKey = c.key
+	Cfg.Backend = c.backend
+
+	if c.signKey != "" {
+		Cfg.SignKey = c.signKey
+		if err := applySigner(r); err != nil {
+			return err
+		}
+	}
+
+	if pub != nil {
+		if err := appendRecipientFile(pub); err != nil {
+			return fmt.Errorf("Unable to add the new key to the repository's recipients: %s", err)
+		}
+
+		fmt.Println("Note: your new key was not a recipient of any secrets already in this repository, so they were left as-is.\nAsk an existing recipient to run `gpass recipients add` with your public key to grant you access, rather than generating a new key on every machine.")
+	}
 
 	if err := store.Save("config.json", Cfg); err != nil {
 		return fmt.Errorf("Failed to save the user config: %s", err)
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/eiso/gpass/encrypt"
+	"github.com/eiso/gpass/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// recipientsFile is the path, relative to the repository root, of the
+// armored public keyring every secret is encrypted to -- analogous to
+// pass's .gpg-id.
+const recipientsFile = ".gpass/recipients.gpg"
+
+type RecipientsCmd struct{}
+
+func NewRecipientsCmd() *RecipientsCmd {
+	return &RecipientsCmd{}
+}
+
+func (c *RecipientsCmd) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Manages the public keys secrets in this repository are encrypted to.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add /path/to/public-key.asc",
+		Short: "Adds a recipient's public key and re-encrypts the repository.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  c.add,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm fingerprint",
+		Short: "Removes a recipient's public key and re-encrypts the repository.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  c.rm,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the public keys secrets in this repository are encrypted to.",
+		Args:  cobra.NoArgs,
+		RunE:  c.list,
+	})
+
+	return cmd
+}
+
+func (c *RecipientsCmd) add(cmd *cobra.Command, args []string) error {
+	pub, err := utils.LoadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("Unable to load the public key: %s", err)
+	}
+
+	if err := applySigner(Cfg.Repository); err != nil {
+		return err
+	}
+
+	if err := loadLocalKeyring(); err != nil {
+		return err
+	}
+
+	return addRecipientKey(pub)
+}
+
+// loadLocalKeyring builds and unlocks the native PGP identity configured in
+// Cfg.PrivateKey, populating encrypt's process-wide keyring so reencryptAll
+// can decrypt the repository's existing secrets. Without this, decrypting
+// relies entirely on a gpass agent happening to already be running.
+func loadLocalKeyring() error {
+	if Cfg.PrivateKey == "" {
+		return fmt.Errorf("No private key configured, run gpass init first")
+	}
+
+	f, err := utils.LoadFile(Cfg.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("Unable to load the private key: %s", err)
+	}
+
+	return encrypt.NewPGP(f, nil, nil, true).Keyring()
+}
+
+// appendRecipientFile appends pub to the repository's recipients file and
+// commits it, without touching any already-encrypted secrets. Use this
+// when pub was never a recipient of the existing ciphertext (e.g. a
+// freshly generated key joining a repo it can't yet decrypt anything in)
+// -- reencryptAll would fail trying to decrypt with a key that was never
+// one of the original recipients.
+func appendRecipientFile(pub []byte) error {
+	p := path.Join(Cfg.Repository.Path, recipientsFile)
+
+	existing, err := ioutil.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to read the recipients file: %s", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+		return fmt.Errorf("Unable to create the .gpass folder: %s", err)
+	}
+
+	merged := append(existing, pub...)
+	if err := ioutil.WriteFile(p, merged, 0600); err != nil {
+		return fmt.Errorf("Unable to write the recipients file: %s", err)
+	}
+
+	return Cfg.Repository.CommitFile(Cfg.User, recipientsFile, "gpass: add recipient")
+}
+
+// addRecipientKey appends pub to the repository's recipients file,
+// re-encrypting any existing secrets to the updated recipient set.
+func addRecipientKey(pub []byte) error {
+	p := path.Join(Cfg.Repository.Path, recipientsFile)
+
+	existing, err := ioutil.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to read the recipients file: %s", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+		return fmt.Errorf("Unable to create the .gpass folder: %s", err)
+	}
+
+	merged := append(existing, pub...)
+	if err := ioutil.WriteFile(p, merged, 0600); err != nil {
+		return fmt.Errorf("Unable to write the recipients file: %s", err)
+	}
+
+	if err := reencryptAll(merged); err != nil {
+		return err
+	}
+
+	return Cfg.Repository.CommitFile(Cfg.User, recipientsFile, "gpass: add recipient")
+}
+
+func (c *RecipientsCmd) rm(cmd *cobra.Command, args []string) error {
+	if err := applySigner(Cfg.Repository); err != nil {
+		return err
+	}
+
+	if err := loadLocalKeyring(); err != nil {
+		return err
+	}
+
+	p := path.Join(Cfg.Repository.Path, recipientsFile)
+
+	k, err := ioutil.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("Unable to read the recipients file: %s", err)
+	}
+
+	ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k))
+	if err != nil {
+		return fmt.Errorf("Unable to parse the recipients file: %s", err)
+	}
+
+	fingerprint := strings.ToUpper(args[0])
+
+	var kept openpgp.EntityList
+	for _, e := range ring {
+		if fmt.Sprintf("%X", e.PrimaryKey.Fingerprint) != fingerprint {
+			kept = append(kept, e)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to armor encode the recipients file: %s", err)
+	}
+	for _, e := range kept {
+		if err := e.Serialize(w); err != nil {
+			return fmt.Errorf("Unable to serialize a recipient: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(p, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("Unable to write the recipients file: %s", err)
+	}
+
+	if err := reencryptAll(buf.Bytes()); err != nil {
+		return err
+	}
+
+	return Cfg.Repository.CommitFile(Cfg.User, recipientsFile, "gpass: remove recipient")
+}
+
+func (c *RecipientsCmd) list(cmd *cobra.Command, args []string) error {
+	p := path.Join(Cfg.Repository.Path, recipientsFile)
+
+	k, err := ioutil.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("Unable to read the recipients file: %s", err)
+	}
+
+	ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k))
+	if err != nil {
+		return fmt.Errorf("Unable to parse the recipients file: %s", err)
+	}
+
+	for _, e := range ring {
+		for _, ident := range e.Identities {
+			fmt.Printf("%X  %s\n", e.PrimaryKey.Fingerprint, ident.Name)
+		}
+	}
+
+	return nil
+}
+
+// reencryptAll walks the repository, decrypting every stored secret with
+// the local private key and re-encrypting it to ring, committing each
+// rewritten file as it goes. ring is parsed into the recipient keyring
+// once, up front, so every file in the walk re-encrypts against the same
+// set instead of an ever-growing, duplicated one.
+func reencryptAll(ring []byte) error {
+	if err := encrypt.SetRecipients(ring); err != nil {
+		return err
+	}
+
+	return filepath.Walk(Cfg.Repository.Path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || path.Ext(p) != ".gpg" {
+			return nil
+		}
+		if p == filepath.Join(Cfg.Repository.Path, recipientsFile) {
+			return nil
+		}
+
+		ciphertext, err := utils.LoadFile(p)
+		if err != nil {
+			return fmt.Errorf("Unable to read %s: %s", p, err)
+		}
+
+		k := encrypt.NewPGP(nil, nil, ciphertext, true)
+		if err := k.Decrypt(); err != nil {
+			return fmt.Errorf("Unable to decrypt %s: %s", p, err)
+		}
+
+		if err := k.Encrypt(); err != nil {
+			return fmt.Errorf("Unable to re-encrypt %s: %s", p, err)
+		}
+
+		if err := ioutil.WriteFile(p, k.Message, 0600); err != nil {
+			return fmt.Errorf("Unable to write %s: %s", p, err)
+		}
+
+		rel, err := filepath.Rel(Cfg.Repository.Path, p)
+		if err != nil {
+			return err
+		}
+
+		return Cfg.Repository.CommitFile(Cfg.User, rel, fmt.Sprintf("gpass: re-encrypt %s", rel))
+	})
+}
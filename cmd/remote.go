@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/eiso/gpass/git"
+	"github.com/spf13/cobra"
+	"github.com/tucnak/store"
+)
+
+type CloneCmd struct {
+	authMode  string
+	httpsUser string
+	tokenEnv  string
+	sshKey    string
+	caBundle  string
+}
+
+func NewCloneCmd() *CloneCmd {
+	return &CloneCmd{}
+}
+
+func (c *CloneCmd) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clone url /path/to/git-repository",
+		Short: "Clones a remote repository of secrets to a local path.",
+		Args:  cobra.ExactArgs(2),
+		RunE:  c.Execute,
+	}
+
+	cmd.Flags().StringVar(&c.authMode, "auth", "", "Remote auth mode: \"https\", \"ssh\", or empty for none.")
+	cmd.Flags().StringVar(&c.httpsUser, "https-user", "", "Username for HTTPS basic auth.")
+	cmd.Flags().StringVar(&c.tokenEnv, "token-env", "GPASS_REMOTE_TOKEN", "Environment variable holding the HTTPS token.")
+	cmd.Flags().StringVar(&c.sshKey, "ssh-key", "", "Path to an SSH private key, falls back to the SSH agent when empty.")
+	cmd.Flags().StringVar(&c.caBundle, "ca-bundle", "", "Path to a CA bundle for self-hosted HTTPS remotes.")
+
+	return cmd
+}
+
+func (c *CloneCmd) auth() *git.RemoteAuth {
+	if c.authMode == "" {
+		return nil
+	}
+
+	return &git.RemoteAuth{
+		Mode:          c.authMode,
+		HTTPSUser:     c.httpsUser,
+		HTTPSTokenEnv: c.tokenEnv,
+		SSHKeyPath:    c.sshKey,
+		CABundle:      c.caBundle,
+	}
+}
+
+func (c *CloneCmd) Execute(cmd *cobra.Command, args []string) error {
+	r := new(git.Repository)
+	r.Path = args[1]
+
+	auth := c.auth()
+
+	if err := r.Clone(args[0], auth); err != nil {
+		return err
+	}
+
+	Cfg.Repository = r
+	Cfg.RemoteURL = args[0]
+	Cfg.RemoteAuth = auth
+
+	if err := store.Save("config.json", Cfg); err != nil {
+		return fmt.Errorf("Failed to save the user config: %s", err)
+	}
+
+	fmt.Printf("Cloned %s into %s\n", args[0], args[1])
+	return nil
+}
+
+type PushCmd struct{}
+
+func NewPushCmd() *PushCmd {
+	return &PushCmd{}
+}
+
+func (c *PushCmd) Cmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "push",
+		Short: "Pushes local commits to the configured remote.",
+		Args:  cobra.NoArgs,
+		RunE:  c.Execute,
+	}
+}
+
+func (c *PushCmd) Execute(cmd *cobra.Command, args []string) error {
+	return Cfg.Repository.Push("", Cfg.RemoteAuth)
+}
+
+type PullCmd struct{}
+
+func NewPullCmd() *PullCmd {
+	return &PullCmd{}
+}
+
+func (c *PullCmd) Cmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull",
+		Short: "Pulls the configured remote's changes into the local repository.",
+		Args:  cobra.NoArgs,
+		RunE:  c.Execute,
+	}
+}
+
+func (c *PullCmd) Execute(cmd *cobra.Command, args []string) error {
+	return Cfg.Repository.Pull("", Cfg.RemoteAuth)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/eiso/gpass/encrypt"
+	"github.com/eiso/gpass/git"
+	"github.com/eiso/gpass/utils"
+)
+
+// applySigner configures r to GPG-sign its commits using Cfg.SignKey. It's
+// a no-op when no signing key has been configured.
+func applySigner(r *git.Repository) error {
+	if Cfg.SignKey == "" {
+		return nil
+	}
+
+	k, err := utils.LoadFile(Cfg.SignKey)
+	if err != nil {
+		return fmt.Errorf("Unable to load the signing key: %s", err)
+	}
+
+	signer, err := encrypt.NewSignKey(k, encrypt.PromptPassphrase())
+	if err != nil {
+		return fmt.Errorf("Unable to load the signing key: %s", err)
+	}
+
+	r.WithSigner(signer)
+
+	return nil
+}
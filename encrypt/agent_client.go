@@ -0,0 +1,92 @@
+package encrypt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	agentOpDecrypt     byte = 'D'
+	agentOpEncrypt     byte = 'E'
+	agentOpSign        byte = 'G'
+	agentOpIdentities  byte = 'I'
+	agentOpFingerprint byte = 'F'
+
+	agentStatusOK byte = 0
+)
+
+// agentSocketPath mirrors agent.SocketPath. It's duplicated rather than
+// imported so encrypt doesn't depend on the daemon package it talks to.
+func agentSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = fmt.Sprintf("%s/gpass-agent-%d", os.TempDir(), os.Getuid())
+	}
+	return fmt.Sprintf("%s/gpass-agent.sock", dir)
+}
+
+// agentHasFingerprint reports whether a running gpass agent already has
+// fingerprint cached, so Keyring can skip prompting for its passphrase.
+// This is deliberately stricter than just checking whether some agent is
+// reachable: a stale or unrelated agent (e.g. from a different repo)
+// being alive says nothing about whether it holds this particular key.
+func agentHasFingerprint(fingerprint string) bool {
+	raw, ok, err := askAgent(agentOpFingerprint, nil)
+	if !ok || err != nil {
+		return false
+	}
+
+	for _, fp := range strings.Split(string(raw), "\n") {
+		if strings.EqualFold(fp, fingerprint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// askAgent asks a running gpass agent to perform op on payload, returning
+// ok=false if no agent is listening so the caller can fall back to
+// in-process crypto.
+func askAgent(op byte, payload []byte) (result []byte, ok bool, err error) {
+	conn, err := net.Dial("unix", agentSocketPath())
+	if err != nil {
+		return nil, false, nil
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte{op}); err != nil {
+		return nil, true, fmt.Errorf("Unable to talk to the gpass agent: %s", err)
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint32(len(payload))); err != nil {
+		return nil, true, fmt.Errorf("Unable to talk to the gpass agent: %s", err)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return nil, true, fmt.Errorf("Unable to talk to the gpass agent: %s", err)
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return nil, true, fmt.Errorf("Unable to read the gpass agent's reply: %s", err)
+	}
+
+	var length uint32
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, true, fmt.Errorf("Unable to read the gpass agent's reply: %s", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, true, fmt.Errorf("Unable to read the gpass agent's reply: %s", err)
+	}
+
+	if status[0] != agentStatusOK {
+		return nil, true, fmt.Errorf("gpass agent: %s", body)
+	}
+
+	return body, true, nil
+}
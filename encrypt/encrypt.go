@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 
 	"golang.org/x/crypto/openpgp"
@@ -14,6 +15,23 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// Crypto is the interface every encryption backend implements, so that
+// NewPGP's built-in OpenPGP implementation and a system-gpg-backed
+// implementation can be used interchangeably.
+type Crypto interface {
+	// Keyring loads and unlocks the identity used for Decrypt/Sign.
+	Keyring() error
+	// Encrypt encrypts the loaded message in place.
+	Encrypt() error
+	// Decrypt decrypts the loaded message in place.
+	Decrypt() error
+	// Sign returns an armored detached signature over data.
+	Sign(data []byte) (string, error)
+	// Identities returns the human-readable identities available on the
+	// loaded key.
+	Identities() []string
+}
+
 // PGP holds the private key/pass and one message (may be encrypted/decrypted) at a time
 type PGP struct {
 	PrivateKey []byte
@@ -24,6 +42,25 @@ type PGP struct {
 
 var entityList openpgp.EntityList
 
+// recipients holds the public keyring a message is encrypted to. When it
+// is non-empty, Encrypt encrypts to it alone, so the local identity in
+// entityList is a recipient only if its key is in this keyring. When
+// empty, Encrypt falls back to encrypting to entityList.
+var recipients openpgp.EntityList
+
+// AddRecipients parses an armored public keyring and adds every entity in
+// it to the current recipient set used by Encrypt.
+func (f *PGP) AddRecipients(k []byte) error {
+	ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k))
+	if err != nil {
+		return fmt.Errorf("Not an armored PGP public keyring: %s", err)
+	}
+
+	recipients = append(recipients, ring...)
+
+	return nil
+}
+
 func NewPGP(k []byte, p openpgp.PromptFunction, m []byte, e bool) *PGP {
 
 	r := new(PGP)
@@ -104,10 +141,14 @@ func (f *PGP) WriteFile(repoPath string, filename string) error {
 	return nil
 }
 
+// Entities returns every entity that Keyring and KeyringWithPassphrase
+// have loaded in this process, for handing off to a gpass agent.
+func Entities() openpgp.EntityList {
+	return entityList
+}
+
 //Keyring builds a pgp keyring based upon the users' private key
 func (f *PGP) Keyring() error {
-	passphraseByte := shellPrompt()
-
 	s := bytes.NewReader([]byte(f.PrivateKey))
 	block, err := armor.Decode(s)
 	if err != nil {
@@ -121,6 +162,13 @@ func (f *PGP) Keyring() error {
 		return fmt.Errorf("Unable to read armor decoded key: %s", err)
 	}
 
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+	if agentHasFingerprint(fingerprint) {
+		return nil
+	}
+
+	passphraseByte := shellPrompt()
+
 	if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
 		err := entity.PrivateKey.Decrypt(passphraseByte)
 		if err != nil {
@@ -137,12 +185,54 @@ func (f *PGP) Keyring() error {
 	return nil
 }
 
+// KeyringWithPassphrase builds a pgp keyring like Keyring, but unlocks it
+// with passphrase instead of prompting for one. Use this right after
+// GenerateKey, where the passphrase was already entered and confirmed --
+// an interactive Keyring call would otherwise prompt for it again.
+func (f *PGP) KeyringWithPassphrase(passphrase []byte) error {
+	s := bytes.NewReader([]byte(f.PrivateKey))
+	block, err := armor.Decode(s)
+	if err != nil {
+		return fmt.Errorf("Not an armor encoded PGP private key: %s", err)
+	} else if block.Type != openpgp.PrivateKeyType {
+		return fmt.Errorf("Not a OpenPGP private key: %s", err)
+	}
+
+	entity, err := openpgp.ReadEntity(packet.NewReader(block.Body))
+	if err != nil {
+		return fmt.Errorf("Unable to read armor decoded key: %s", err)
+	}
+
+	if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("Failed to decrypt main private key: %s", err)
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		subkey.PrivateKey.Decrypt(passphrase)
+	}
+
+	entityList = append(entityList, entity)
+
+	return nil
+}
+
 // Decrypt a message
 func (f *PGP) Decrypt() error {
 	if !f.Encrypted {
 		return fmt.Errorf("The message is not encrypted")
 	}
 
+	if plaintext, ok, err := askAgent(agentOpDecrypt, f.Message); ok {
+		if err != nil {
+			return err
+		}
+		f.Encrypted = false
+		f.Message = plaintext
+		return nil
+	}
+
 	block, err := armor.Decode(bytes.NewReader([]byte(f.Message)))
 	if err != nil {
 		return fmt.Errorf("Invalid PGP message or not armor encoded: %s", err)
@@ -167,12 +257,194 @@ func (f *PGP) Decrypt() error {
 	return nil
 }
 
+// SignKey wraps an OpenPGP entity used to produce detached signatures,
+// loaded from whichever armored private key is passed to NewSignKey. It
+// is not tied to the key used for message encryption.
+type SignKey struct {
+	Entity *openpgp.Entity
+}
+
+// NewSignKey decodes an armored private key and decrypts it with the given
+// passphrase, returning a SignKey ready to sign commits.
+func NewSignKey(k []byte, passphrase []byte) (*SignKey, error) {
+	block, err := armor.Decode(bytes.NewReader(k))
+	if err != nil {
+		return nil, fmt.Errorf("Not an armor encoded PGP private key: %s", err)
+	} else if block.Type != openpgp.PrivateKeyType {
+		return nil, fmt.Errorf("Not a OpenPGP private key")
+	}
+
+	entity, err := openpgp.ReadEntity(packet.NewReader(block.Body))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read armor decoded key: %s", err)
+	}
+
+	if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+			return nil, fmt.Errorf("Failed to decrypt signing key: %s", err)
+		}
+	}
+
+	return &SignKey{Entity: entity}, nil
+}
+
+// Sign returns an armored detached PGP signature over data.
+func (s *SignKey) Sign(data []byte) (string, error) {
+	var sig bytes.Buffer
+
+	if err := openpgp.ArmoredDetachSign(&sig, s.Entity, bytes.NewReader(data), nil); err != nil {
+		return "", fmt.Errorf("Unable to sign data: %s", err)
+	}
+
+	return sig.String(), nil
+}
+
+// Sign returns an armored detached PGP signature over data, using the
+// private key loaded by Keyring (or cached in a running gpass agent).
+func (f *PGP) Sign(data []byte) (string, error) {
+	if sig, ok, err := askAgent(agentOpSign, data); ok {
+		if err != nil {
+			return "", err
+		}
+		return string(sig), nil
+	}
+
+	if len(entityList) == 0 {
+		return "", fmt.Errorf("No private key loaded, call Keyring first")
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entityList[0], bytes.NewReader(data), nil); err != nil {
+		return "", fmt.Errorf("Unable to sign data: %s", err)
+	}
+
+	return sig.String(), nil
+}
+
+// Identities returns the human-readable identities on the private key
+// loaded by Keyring (or cached in a running gpass agent).
+func (f *PGP) Identities() []string {
+	if raw, ok, err := askAgent(agentOpIdentities, nil); ok {
+		if err != nil || len(raw) == 0 {
+			return nil
+		}
+		return strings.Split(string(raw), "\n")
+	}
+
+	var ids []string
+
+	for _, e := range entityList {
+		for _, ident := range e.Identities {
+			ids = append(ids, ident.Name)
+		}
+	}
+
+	return ids
+}
+
+// PromptPassphrase prompts once for a passphrase.
+func PromptPassphrase() []byte {
+	return shellPrompt()
+}
+
+// SetRecipients parses an armored public keyring and replaces the current
+// recipient set used by Encrypt, rather than appending to it. Use this
+// when k already represents the authoritative, full recipient list (e.g.
+// re-parsing a repo's recipients file once, rather than merging it in
+// repeatedly).
+func SetRecipients(k []byte) error {
+	ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k))
+	if err != nil {
+		return fmt.Errorf("Not an armored PGP public keyring: %s", err)
+	}
+
+	recipients = ring
+
+	return nil
+}
+
+// PromptNewPassphrase prompts for a new passphrase twice, failing if the
+// two entries don't match.
+func PromptNewPassphrase() ([]byte, error) {
+	fmt.Print("Enter a new passphrase: ")
+	first := shellPrompt()
+
+	fmt.Print("Confirm the new passphrase: ")
+	second := shellPrompt()
+
+	if !bytes.Equal(first, second) {
+		return nil, fmt.Errorf("Passphrases did not match")
+	}
+
+	return first, nil
+}
+
+// GenerateKey creates a new OpenPGP entity for name/email, encrypts its
+// private key material with passphrase, and returns the armored private
+// and public halves along with the key's fingerprint.
+func GenerateKey(name string, email string, passphrase []byte) (priv []byte, pub []byte, fingerprint string, err error) {
+	entity, err := openpgp.NewEntity(name, "", email, nil)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to generate a new key: %s", err)
+	}
+
+	if err := entity.PrivateKey.Encrypt(passphrase); err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to encrypt the new private key: %s", err)
+	}
+	for _, subkey := range entity.Subkeys {
+		if err := subkey.PrivateKey.Encrypt(passphrase); err != nil {
+			return nil, nil, "", fmt.Errorf("Unable to encrypt a subkey: %s", err)
+		}
+	}
+
+	var privBuf bytes.Buffer
+	pw, err := armor.Encode(&privBuf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := entity.SerializePrivate(pw, nil); err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to serialize the private key: %s", err)
+	}
+	if err := pw.Close(); err != nil {
+		return nil, nil, "", err
+	}
+
+	var pubBuf bytes.Buffer
+	bw, err := armor.Encode(&pubBuf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := entity.Serialize(bw); err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to serialize the public key: %s", err)
+	}
+	if err := bw.Close(); err != nil {
+		return nil, nil, "", err
+	}
+
+	fingerprint = fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+
+	return privBuf.Bytes(), pubBuf.Bytes(), fingerprint, nil
+}
+
 // Encrypt a message
 func (f *PGP) Encrypt() error {
 	if f.Encrypted {
 		return fmt.Errorf("The message is encrypted already")
 	}
 
+	// The agent only encrypts to its own cached keyring, so an explicit
+	// recipient set is always encrypted to in-process.
+	if len(recipients) == 0 {
+		if ciphertext, ok, err := askAgent(agentOpEncrypt, f.Message); ok {
+			if err != nil {
+				return err
+			}
+			f.Encrypted = true
+			f.Message = ciphertext
+			return nil
+		}
+	}
+
 	var w bytes.Buffer
 
 	b, err := armor.Encode(&w, "PGP MESSAGE", nil)
@@ -180,7 +452,12 @@ func (f *PGP) Encrypt() error {
 		return fmt.Errorf("Unable to armor encode")
 	}
 
-	e, err := openpgp.Encrypt(b, entityList, nil, nil, nil)
+	to := entityList
+	if len(recipients) > 0 {
+		to = recipients
+	}
+
+	e, err := openpgp.Encrypt(b, to, nil, nil, nil)
 	if err != nil {
 		return fmt.Errorf("Unable to load keyring for encryption: %s", err)
 	}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/eiso/gpass/encrypt"
 	homedir "github.com/mitchellh/go-homedir"
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
@@ -19,6 +20,73 @@ type Repository struct {
 	// Path is the full system path to the git repository
 	Path string
 	root *git.Repository
+	// signer, when set via WithSigner, GPG-signs every commit this
+	// Repository creates
+	signer *encrypt.SignKey
+}
+
+// WithSigner configures the repository to GPG-sign future commits with s.
+// Pass nil to stop signing commits.
+func (r *Repository) WithSigner(s *encrypt.SignKey) {
+	r.signer = s
+}
+
+// sign rewrites the commit at hash to carry a detached PGP signature from
+// r.signer, returning the hash of the signed commit. It is a no-op if no
+// signer has been configured.
+func (r *Repository) sign(hash plumbing.Hash) (plumbing.Hash, error) {
+	if r.signer == nil {
+		return hash, nil
+	}
+
+	commit, err := r.root.CommitObject(hash)
+	if err != nil {
+		return hash, fmt.Errorf("Unable to load commit for signing: %s", err)
+	}
+	commit.PGPSignature = ""
+
+	unsigned := r.root.Storer.NewEncodedObject()
+	if err := commit.Encode(unsigned); err != nil {
+		return hash, fmt.Errorf("Unable to encode commit for signing: %s", err)
+	}
+
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return hash, fmt.Errorf("Unable to read encoded commit: %s", err)
+	}
+	defer reader.Close()
+
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return hash, fmt.Errorf("Unable to read encoded commit: %s", err)
+	}
+
+	sig, err := r.signer.Sign(raw)
+	if err != nil {
+		return hash, fmt.Errorf("Unable to sign commit: %s", err)
+	}
+	commit.PGPSignature = sig
+
+	signed := r.root.Storer.NewEncodedObject()
+	if err := commit.Encode(signed); err != nil {
+		return hash, fmt.Errorf("Unable to encode signed commit: %s", err)
+	}
+
+	newHash, err := r.root.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return hash, fmt.Errorf("Unable to store signed commit: %s", err)
+	}
+
+	head, err := r.root.Head()
+	if err != nil {
+		return hash, fmt.Errorf("Unable to load HEAD: %s", err)
+	}
+
+	if err := r.root.Storer.SetReference(plumbing.NewHashReference(head.Name(), newHash)); err != nil {
+		return hash, fmt.Errorf("Unable to point HEAD at the signed commit: %s", err)
+	}
+
+	return newHash, nil
 }
 
 // User is the relevant user information
@@ -147,7 +215,7 @@ func (r *Repository) CreateOrphanBranch(u *User, s string) error {
 	var h []plumbing.Hash
 
 	msg := fmt.Sprintf("creating branch for: %s", s)
-	_, err = w.Commit(msg, &git.CommitOptions{
+	hash, err := w.Commit(msg, &git.CommitOptions{
 		Author: &object.Signature{
 			Name:  u.Name,
 			Email: u.Email,
@@ -159,6 +227,10 @@ func (r *Repository) CreateOrphanBranch(u *User, s string) error {
 		return fmt.Errorf("Unable to make the initial commit: %s", err)
 	}
 
+	if _, err := r.sign(hash); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -246,7 +318,7 @@ func (r *Repository) CommitFile(u *User, filename string, msg string) error {
 		return fmt.Errorf("Unable to git add the file: %s", err)
 	}
 
-	_, err = w.Commit(msg, &git.CommitOptions{
+	hash, err := w.Commit(msg, &git.CommitOptions{
 		Author: &object.Signature{
 			Name:  u.Name,
 			Email: u.Email,
@@ -259,6 +331,10 @@ func (r *Repository) CommitFile(u *User, filename string, msg string) error {
 		return fmt.Errorf("Unable to commit: %s", err)
 	}
 
+	if _, err := r.sign(hash); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -269,7 +345,7 @@ func (r *Repository) Commit(u *User, filename string, msg string) error {
 		return fmt.Errorf("Unable to load the work tree: %s", err)
 	}
 
-	_, err = w.Commit(msg, &git.CommitOptions{
+	hash, err := w.Commit(msg, &git.CommitOptions{
 		Author: &object.Signature{
 			Name:  u.Name,
 			Email: u.Email,
@@ -282,6 +358,10 @@ func (r *Repository) Commit(u *User, filename string, msg string) error {
 		return fmt.Errorf("Unable to commit: %s", err)
 	}
 
+	if _, err := r.sign(hash); err != nil {
+		return err
+	}
+
 	return nil
 
 }
@@ -0,0 +1,169 @@
+package git
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitclient "gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// RemoteAuth describes how to authenticate against a remote: HTTPS basic
+// auth with a token read from an environment variable, or SSH via a key
+// file (falling back to the SSH agent when none is given).
+type RemoteAuth struct {
+	// Mode is "https", "ssh", or "" for an unauthenticated remote
+	Mode string
+	// HTTPSUser is the basic-auth username for an HTTPS remote
+	HTTPSUser string
+	// HTTPSTokenEnv names the environment variable holding the HTTPS token
+	HTTPSTokenEnv string
+	// SSHKeyPath points at a private key to use instead of the SSH agent
+	SSHKeyPath string
+	// CABundle is a path to a PEM CA bundle for self-hosted HTTPS remotes
+	CABundle string
+}
+
+// method builds the go-git transport.AuthMethod described by a.
+func (a *RemoteAuth) method() (transport.AuthMethod, error) {
+	switch a.Mode {
+	case "https":
+		token := os.Getenv(a.HTTPSTokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("Environment variable %s is not set", a.HTTPSTokenEnv)
+		}
+		return &githttp.BasicAuth{Username: a.HTTPSUser, Password: token}, nil
+	case "ssh":
+		if a.SSHKeyPath != "" {
+			return ssh.NewPublicKeysFromFile("git", a.SSHKeyPath, "")
+		}
+		return ssh.NewSSHAgentAuth("git")
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown remote auth mode: %s", a.Mode)
+	}
+}
+
+// useCABundle installs a custom HTTPS transport trusting the CA bundle at
+// path, for talking to self-hosted Bitbucket/Gitea servers.
+func useCABundle(path string) error {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read the CA bundle: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("No certificates found in %s", path)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+
+	gitclient.InstallProtocol("https", githttp.NewClient(client))
+
+	return nil
+}
+
+// Clone clones url into r.Path, authenticating with auth if non-nil.
+func (r *Repository) Clone(url string, auth *RemoteAuth) error {
+	o := &git.CloneOptions{URL: url}
+
+	if auth != nil {
+		if auth.CABundle != "" {
+			if err := useCABundle(auth.CABundle); err != nil {
+				return err
+			}
+		}
+
+		m, err := auth.method()
+		if err != nil {
+			return fmt.Errorf("Unable to build the remote auth method: %s", err)
+		}
+		o.Auth = m
+	}
+
+	s, err := git.PlainClone(r.Path, false, o)
+	if err != nil {
+		return fmt.Errorf("Unable to clone %s: %s", url, err)
+	}
+
+	r.root = s
+	return nil
+}
+
+// Push pushes the current branch to remote ("origin" if empty),
+// authenticating with auth if non-nil.
+func (r *Repository) Push(remote string, auth *RemoteAuth) error {
+	if remote == "" {
+		remote = "origin"
+	}
+
+	o := &git.PushOptions{RemoteName: remote}
+
+	if auth != nil {
+		if auth.CABundle != "" {
+			if err := useCABundle(auth.CABundle); err != nil {
+				return err
+			}
+		}
+
+		m, err := auth.method()
+		if err != nil {
+			return fmt.Errorf("Unable to build the remote auth method: %s", err)
+		}
+		o.Auth = m
+	}
+
+	if err := r.root.Push(o); err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("Unable to push to %s: %s", remote, err)
+	}
+
+	return nil
+}
+
+// Pull fast-forwards the current branch from remote ("origin" if empty),
+// authenticating with auth if non-nil.
+func (r *Repository) Pull(remote string, auth *RemoteAuth) error {
+	w, err := r.root.Worktree()
+	if err != nil {
+		return fmt.Errorf("Unable to load the work tree: %s", err)
+	}
+
+	if remote == "" {
+		remote = "origin"
+	}
+
+	o := &git.PullOptions{RemoteName: remote}
+
+	if auth != nil {
+		if auth.CABundle != "" {
+			if err := useCABundle(auth.CABundle); err != nil {
+				return err
+			}
+		}
+
+		m, err := auth.method()
+		if err != nil {
+			return fmt.Errorf("Unable to build the remote auth method: %s", err)
+		}
+		o.Auth = m
+	}
+
+	if err := w.Pull(o); err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("Unable to pull from %s: %s", remote, err)
+	}
+
+	return nil
+}